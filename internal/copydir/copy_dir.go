@@ -0,0 +1,129 @@
+package copydir
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CopyFlags customize the behavior of CopyDir's per-file copy.
+type CopyFlags uint
+
+const (
+	// CopyDefault copies every regular file byte-for-byte.
+	CopyDefault CopyFlags = 0
+
+	// CopyHardlink tells CopyDir to hardlink regular files into dst instead
+	// of copying their contents, falling back to a regular copy for any
+	// file where hardlinking isn't possible (for example because src and
+	// dst are on different filesystems). This is useful for populating a
+	// workspace's local plugin directory from a shared global plugin cache
+	// without paying the cost of a full copy for every workspace.
+	CopyHardlink CopyFlags = 1 << iota
+)
+
+// CopyDir copies the src directory to dst. Both directories should already
+// exist.
+//
+// If no flags are given, every regular file is fully copied. Pass
+// CopyHardlink to hardlink regular files instead, which works as long as
+// src and dst are on the same device; files that can't be hardlinked (most
+// commonly because they cross a filesystem boundary) still fall back to a
+// full copy.
+func CopyDir(dst, src string, flags ...CopyFlags) error {
+	var flag CopyFlags
+	for _, f := range flags {
+		flag |= f
+	}
+
+	src, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// If this is the root directory of the walk, dst already
+		// represents it, so there's nothing else to do here.
+		if path == src {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dst, relPath)
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dstPath)
+
+		case info.IsDir():
+			return os.MkdirAll(dstPath, info.Mode())
+
+		default:
+			if flag&CopyHardlink != 0 {
+				if err := os.Link(path, dstPath); err == nil {
+					return nil
+				}
+				// Hardlinking can fail for reasons including crossing a
+				// filesystem boundary (EXDEV) or a platform that simply
+				// doesn't support it (EPERM), so we fall back to copying
+				// the file's bytes directly in that case.
+			}
+			return copyFile(path, dstPath, info.Mode())
+		}
+	}
+
+	return filepath.Walk(src, walkFn)
+}
+
+// SameFile reports whether path1 and path2 refer to the same underlying
+// file or directory on disk, comparing the OS-level device and file
+// identifiers rather than the two (possibly different) virtual paths.
+func SameFile(path1, path2 string) (bool, error) {
+	info1, err := os.Stat(path1)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	info2, err := os.Stat(path2)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return os.SameFile(info1, info2), nil
+}
+
+// copyFile copies the contents of src to dst, creating dst with the given
+// file mode.
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -1,15 +1,26 @@
 package providercache
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"hash"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	getter "github.com/hashicorp/go-getter"
+	"github.com/klauspost/compress/zstd"
 
+	"github.com/hashicorp/terraform/addrs"
 	"github.com/hashicorp/terraform/httpclient"
 	"github.com/hashicorp/terraform/internal/copydir"
 	"github.com/hashicorp/terraform/internal/getproviders"
@@ -22,7 +33,164 @@ import (
 // specific protocol and set of expectations.)
 var unzip = getter.ZipDecompressor{}
 
-func installFromHTTPURL(ctx context.Context, meta getproviders.PackageMeta, targetDir string) (*getproviders.PackageAuthenticationResult, error) {
+// archiveDecompressor extracts a downloaded provider package archive at src
+// into dst. dir says whether dst is a directory, matching go-getter's
+// decompressor interface; installFromLocalArchive always passes true, and
+// tarDecompressor ignores it and always extracts into a directory. No
+// top-level directory within the archive is stripped or expanded.
+type archiveDecompressor interface {
+	Decompress(dst, src string, dir bool) error
+}
+
+// archiveDecompressors maps the filename suffix of a provider package
+// archive to the decompressor that knows how to extract it. Registry
+// mirrors and network mirrors aren't required to serve zip files, so we
+// support a couple of tar-based formats too, since they're cheaper to
+// produce from existing CI pipelines.
+var archiveDecompressors = map[string]archiveDecompressor{
+	".zip":     unzip,
+	".tar.gz":  tarDecompressor{gzip: true},
+	".tgz":     tarDecompressor{gzip: true},
+	".tar.zst": tarDecompressor{zstd: true},
+}
+
+// archiveSuffixes lists the suffixes in archiveDecompressors that
+// archiveSuffix checks for, so that a multi-part suffix such as ".tar.gz" is
+// recognized whole rather than as the ".gz" that filepath.Ext would report.
+// None of them is a suffix of another, so their order doesn't matter.
+var archiveSuffixes = []string{".tar.gz", ".tar.zst", ".tgz", ".zip"}
+
+// archiveSuffix returns the recognized archive suffix of filename, or
+// whatever filepath.Ext reports if none of the known multi-part suffixes
+// match.
+func archiveSuffix(filename string) string {
+	lower := strings.ToLower(filename)
+	for _, suffix := range archiveSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return suffix
+		}
+	}
+	return filepath.Ext(filename)
+}
+
+// decompressorForFilename returns the archiveDecompressor registered for
+// filename's archive suffix, or an error if the format isn't supported.
+func decompressorForFilename(filename string) (archiveDecompressor, error) {
+	suffix := archiveSuffix(filename)
+	d, ok := archiveDecompressors[suffix]
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider package archive format for %q", filename)
+	}
+	return d, nil
+}
+
+// contentTypeSuffix maps an HTTP Content-Type to the archive suffix we
+// should treat a download as having, for the case where the source URL
+// itself doesn't end in a recognized suffix.
+func contentTypeSuffix(contentType string) string {
+	switch {
+	case strings.Contains(contentType, "zstd"):
+		return ".tar.zst"
+	case strings.Contains(contentType, "gzip"):
+		return ".tar.gz"
+	case strings.Contains(contentType, "zip"):
+		return ".zip"
+	default:
+		return ""
+	}
+}
+
+// packageHashingAuthentication is implemented by authentication
+// implementations that can expose the hash they expect a package to match,
+// so that installFromHTTPURL can verify the download as it streams rather
+// than re-reading the whole file from disk afterward.
+type packageHashingAuthentication interface {
+	ExpectedHash() string
+}
+
+// downloadTempFilename returns the stable path under os.TempDir that a
+// download of the given package should be staged at. It's deterministic in
+// the provider, version and target platform so that a second install
+// attempt after an interrupted download can find and resume the same file.
+func downloadTempFilename(meta getproviders.PackageMeta) string {
+	name := fmt.Sprintf(
+		"terraform-provider-%s_%s_%s%s",
+		meta.Provider.String(), meta.Version.String(), meta.TargetPlatform.String(), archiveSuffix(meta.Filename),
+	)
+	return filepath.Join(os.TempDir(), strings.ReplaceAll(name, string(filepath.Separator), "_"))
+}
+
+// downloadLockStaleAfter is how old a download lock file can get before
+// another process is allowed to assume its owner crashed and steal it, so a
+// killed process can't wedge future installs forever. The lock's age counts
+// from when it was created; it isn't refreshed while its owner is still
+// downloading.
+const downloadLockStaleAfter = 10 * time.Minute
+
+// acquireDownloadLock claims an exclusive, whole-machine lock on the
+// deterministic path that downloadTempFilename returns for meta, blocking
+// (politely, via polling) until any other process or goroutine that's
+// currently downloading the very same provider version has released it.
+//
+// This matters because downloadTempFilename's path is shared by every
+// process on the machine, not just goroutines within one installPackages
+// call: terraform explicitly supports multiple concurrent `init`s against a
+// single global TF_PLUGIN_CACHE_DIR, and without this lock two of them
+// racing to fetch the same package could interleave their writes to the
+// same file, or have one's full refetch (O_TRUNC) stomp the other's resume
+// (O_APPEND), producing a corrupt archive.
+func acquireDownloadLock(ctx context.Context, meta getproviders.PackageMeta) (release func(), err error) {
+	lockPath := downloadTempFilename(meta) + ".lock"
+	for {
+		lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			lock.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create lock file %s: %s", lockPath, err)
+		}
+
+		if fi, statErr := os.Stat(lockPath); statErr == nil && time.Since(fi.ModTime()) > downloadLockStaleAfter {
+			// Whatever process created this lock is long gone; reclaim it
+			// rather than waiting on it forever.
+			os.Remove(lockPath)
+			continue
+		}
+
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// progressFunc is called periodically during a download with the number of
+// bytes fetched so far and, if known, the total size of the package. total
+// is -1 if the size isn't known in advance.
+type progressFunc func(downloaded, total int64)
+
+// progressWriter wraps an io.Writer and reports cumulative bytes written
+// through onProgress as they're written, so installFromHTTPURL can surface
+// download progress without buffering the whole response first.
+type progressWriter struct {
+	io.Writer
+	downloaded int64
+	total      int64
+	onProgress progressFunc
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.downloaded += int64(n)
+	if w.onProgress != nil {
+		w.onProgress(w.downloaded, w.total)
+	}
+	return n, err
+}
+
+func installFromHTTPURL(ctx context.Context, meta getproviders.PackageMeta, targetDir string, progress progressFunc, onFetchComplete func()) (*getproviders.PackageAuthenticationResult, error) {
 	url := meta.Location.String()
 
 	// When we're installing from an HTTP URL we expect the URL to refer to
@@ -30,50 +198,158 @@ func installFromHTTPURL(ctx context.Context, meta getproviders.PackageMeta, targ
 	// delegate to installFromLocalArchive below to actually extract it.
 	// (We're not using go-getter here because its HTTP getter has a bunch
 	// of extraneous functionality we don't need or want, like indirection
-	// through X-Terraform-Get header, attempting partial fetches for
-	// files that already exist, etc.)
+	// through X-Terraform-Get header, etc.)
+	//
+	// The temporary file is named deterministically from the provider,
+	// version and target platform so that if a previous attempt to install
+	// this exact package was interrupted partway through we can resume it
+	// with a ranged request instead of starting over.
+
+	release, err := acquireDownloadLock(ctx, meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim download of %s: %s", url, err)
+	}
+	defer release()
+
+	archiveFilename := downloadTempFilename(meta)
+	var startOffset int64
+	if fi, err := os.Stat(archiveFilename); err == nil && fi.Mode().IsRegular() {
+		startOffset = fi.Size()
+	}
 
 	httpClient := httpclient.New()
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("invalid provider download request: %s", err)
 	}
+	if startOffset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", startOffset))
+	}
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	var f *os.File
+	var expectSize int64
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The server either ignored our Range request or we didn't send
+		// one; either way we must (re)write the file from the start.
+		f, err = os.OpenFile(archiveFilename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		startOffset = 0
+		expectSize = resp.ContentLength
+	case http.StatusPartialContent:
+		f, err = os.OpenFile(archiveFilename, os.O_WRONLY|os.O_APPEND, 0600)
+		expectSize = -1
+		if resp.ContentLength >= 0 {
+			expectSize = startOffset + resp.ContentLength
+		}
+	default:
 		return nil, fmt.Errorf("unsuccessful request to %s: %s", url, resp.Status)
 	}
-
-	f, err := ioutil.TempFile("", "terraform-provider")
 	if err != nil {
-		return nil, fmt.Errorf("failed to open temporary file to download from %s", url)
+		return nil, fmt.Errorf("failed to open temporary file to download %s into: %s", url, err)
 	}
 	defer f.Close()
 
+	// If meta.Authentication can hand us the hash it expects up front, we
+	// hash the response body as we stream it to disk so that, for a
+	// non-resumed download, we don't need to re-read the whole file from
+	// disk afterward just to verify it. Most PackageAuthentication
+	// implementations don't support this, in which case we skip computing
+	// a digest nobody will ever look at and fall back to the existing
+	// read-from-disk AuthenticatePackage path below.
+	hashAuth, streamVerify := meta.Authentication.(packageHashingAuthentication)
+	var digest hash.Hash
+	bodyWriter := io.Writer(f)
+	if streamVerify {
+		digest = sha256.New()
+		bodyWriter = io.MultiWriter(f, digest)
+	}
+	w := &progressWriter{
+		Writer:     bodyWriter,
+		downloaded: startOffset,
+		total:      expectSize,
+		onProgress: progress,
+	}
+
 	// We'll borrow go-getter's "cancelable copy" implementation here so that
-	// the download can potentially be interrupted partway through.
-	n, err := getter.Copy(ctx, f, resp.Body)
-	if err == nil && n < resp.ContentLength {
-		err = fmt.Errorf("incorrect response size: expected %d bytes, but got %d bytes", resp.ContentLength, n)
+	// the download can potentially be interrupted partway through, leaving
+	// the partial file in place ready to be resumed by a later attempt.
+	n, err := getter.Copy(ctx, w, resp.Body)
+	if err == nil && startOffset+n < expectSize {
+		err = fmt.Errorf("incorrect response size: expected %d bytes, but got %d bytes", expectSize, startOffset+n)
 	}
 	if err != nil {
 		return nil, err
 	}
+	if cerr := f.Close(); cerr != nil {
+		return nil, fmt.Errorf("failed to write %s to disk: %s", url, cerr)
+	}
+
+	if streamVerify && startOffset > 0 {
+		// We resumed a previous download, so our streaming hash only
+		// covered the part we just fetched. Re-hash the whole file now
+		// that it's complete; this only happens once per resumed package,
+		// not on every byte of every download.
+		whole, err := os.Open(archiveFilename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reopen %s to verify it: %s", archiveFilename, err)
+		}
+		digest = sha256.New()
+		_, err = io.Copy(digest, whole)
+		whole.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify %s: %s", archiveFilename, err)
+		}
+	}
+
+	// If meta.Filename didn't give us a recognizable archive suffix, fall
+	// back to sniffing the response's Content-Type so that
+	// installFromLocalArchive below still knows which decompressor to use.
+	finalFilename := archiveFilename
+	if _, err := decompressorForFilename(archiveFilename); err != nil {
+		if suffix := contentTypeSuffix(resp.Header.Get("Content-Type")); suffix != "" {
+			finalFilename = archiveFilename + suffix
+			if err := os.Rename(archiveFilename, finalFilename); err != nil {
+				return nil, fmt.Errorf("failed to stage downloaded archive: %s", err)
+			}
+		}
+	}
 
-	archiveFilename := f.Name()
-	localLocation := getproviders.PackageLocalArchive(archiveFilename)
+	localLocation := getproviders.PackageLocalArchive(finalFilename)
 
 	var authResult *getproviders.PackageAuthenticationResult
 	if meta.Authentication != nil {
-		if authResult, err = meta.Authentication.AuthenticatePackage(localLocation); err != nil {
+		if streamVerify {
+			if gotHash := fmt.Sprintf("%x", digest.Sum(nil)); gotHash != hashAuth.ExpectedHash() {
+				// The file at finalFilename is staged under a name that's
+				// deterministic in the provider, version and target
+				// platform, so if we leave it behind here then every
+				// subsequent install attempt will find it, believe it's a
+				// previous partial download, and try to resume from its
+				// (wrong) full length, which fails forever until something
+				// removes this file by hand. A checksum failure means the
+				// content can't be trusted, so we always start clean next
+				// time instead.
+				os.Remove(finalFilename)
+				return nil, fmt.Errorf("package for %s does not match the expected checksum", meta.Provider)
+			}
+		} else if authResult, err = meta.Authentication.AuthenticatePackage(localLocation); err != nil {
+			os.Remove(finalFilename)
 			return authResult, err
 		}
 	}
 
+	// The fetch is done and verified at this point, so anything left to do
+	// is extraction; let the caller know the fetch/extract boundary has
+	// been crossed before we get started on that.
+	if onFetchComplete != nil {
+		onFetchComplete()
+	}
+
 	// We can now delegate to installFromLocalArchive for extraction. To do so,
 	// we construct a new package meta description using the local archive
 	// path as the location, and skipping authentication.
@@ -89,6 +365,10 @@ func installFromHTTPURL(ctx context.Context, meta getproviders.PackageMeta, targ
 	if _, err := installFromLocalArchive(ctx, localMeta, targetDir); err != nil {
 		return nil, err
 	}
+
+	// Installation succeeded, so the staged download is no longer needed.
+	os.Remove(finalFilename)
+
 	return authResult, nil
 }
 
@@ -102,7 +382,19 @@ func installFromLocalArchive(ctx context.Context, meta getproviders.PackageMeta,
 	}
 	filename := meta.Location.String()
 
-	err := unzip.Decompress(targetDir, filename, true)
+	decompressor, err := decompressorForFilename(filename)
+	if err != nil {
+		return authResult, err
+	}
+
+	// We extract into a sibling temporary directory first and only move it
+	// into place once extraction has completely succeeded, so that an
+	// interrupted init can never leave a half-unzipped provider at
+	// targetDir that a later ensureProviderVersions would mistake for a
+	// valid cache entry.
+	err = installExtractedAtomically(targetDir, func(tmpDir string) error {
+		return decompressor.Decompress(tmpDir, filename, true)
+	})
 	if err != nil {
 		return authResult, err
 	}
@@ -110,11 +402,159 @@ func installFromLocalArchive(ctx context.Context, meta getproviders.PackageMeta,
 	return authResult, nil
 }
 
+// tarDecompressor extracts tar-based provider package archives, optionally
+// gzip- or zstd-compressed, into a target directory. Unlike go-getter's zip
+// decompressor it never buffers the whole archive in memory: entries are
+// streamed straight from the (possibly compressed) reader to disk.
+type tarDecompressor struct {
+	gzip bool
+	zstd bool
+}
+
+func (d tarDecompressor) Decompress(dst, src string, dir bool) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := io.Reader(f)
+	switch {
+	case d.gzip:
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to open %s as a gzip stream: %s", src, err)
+		}
+		defer gz.Close()
+		r = gz
+	case d.zstd:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to open %s as a zstd stream: %s", src, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s: %s", src, err)
+		}
+
+		targetPath, err := safeJoin(dst, hdr.Name)
+		if err != nil {
+			return fmt.Errorf("invalid entry %q in %s: %s", hdr.Name, src, err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(targetPath, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(hdr.Mode))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+
+		case tar.TypeSymlink:
+			// hdr.Linkname is the raw string we're about to pass to
+			// os.Symlink, so we must validate *that* value, not some
+			// separately-joined path: filepath.Join silently drops a
+			// leading "/" in its later arguments, so joining it onto dst
+			// would make an absolute target like "/etc/passwd" look safe
+			// even though os.Symlink would create a link straight to
+			// system root. We also have to resolve relative targets
+			// against the symlink's own directory, not dst, since that's
+			// how the resulting on-disk link will actually be followed.
+			if filepath.IsAbs(hdr.Linkname) {
+				return fmt.Errorf("invalid symlink target %q in %s: absolute symlink targets are not allowed", hdr.Linkname, src)
+			}
+			resolved := filepath.Join(filepath.Dir(targetPath), hdr.Linkname)
+			if resolved != dst && !strings.HasPrefix(resolved, dst+string(filepath.Separator)) {
+				return fmt.Errorf("invalid symlink target %q in %s: escapes target directory", hdr.Linkname, src)
+			}
+			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, targetPath); err != nil {
+				return err
+			}
+
+		default:
+			// Provider packages don't contain device files, FIFOs, etc.,
+			// so we silently skip anything else we encounter.
+		}
+	}
+}
+
+// safeJoin joins name onto dir and returns an error if the result would
+// resolve outside of dir, guarding against a maliciously-crafted archive
+// entry trying to escape the extraction directory (the "zip-slip"/"tar-slip"
+// class of vulnerability).
+func safeJoin(dir, name string) (string, error) {
+	target := filepath.Join(dir, name)
+	if target != dir && !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("path escapes target directory")
+	}
+	return target, nil
+}
+
+// installFromLocalDirLinkMode describes how installFromLocalDir should
+// materialize a package into the target directory when a symlink isn't
+// possible.
+type installFromLocalDirLinkMode rune
+
+const (
+	// installFromLocalDirLinkModeCopy is the default behavior: a full
+	// recursive byte-for-byte copy of the source directory.
+	installFromLocalDirLinkModeCopy installFromLocalDirLinkMode = 0
+
+	// installFromLocalDirLinkModeHardlink hardlinks regular files into the
+	// target directory instead of copying their contents, falling back to a
+	// regular copy for any file where hardlinking isn't possible (for
+	// example because the source and target are on different filesystems).
+	// This is useful on platforms where symlinks aren't always available,
+	// such as Windows without administrator privileges or legacy FAT
+	// filesystems, while still avoiding the cost of a full copy for the
+	// common case of linking from the global plugin cache directory.
+	installFromLocalDirLinkModeHardlink installFromLocalDirLinkMode = 'h'
+)
+
 // installFromLocalDir is the implementation of both installing a package from
 // a local directory source _and_ of linking a package from another cache
 // in LinkFromOtherCache, because they both do fundamentally the same
 // operation: symlink if possible, or deep-copy otherwise.
-func installFromLocalDir(ctx context.Context, meta getproviders.PackageMeta, targetDir string) (*getproviders.PackageAuthenticationResult, error) {
+//
+// requireSourceSentinel should be set when sourceDir is expected to itself
+// be a previously-installed provider cache entry, as is the case when
+// linking from another plugin cache directory. It causes installFromLocalDir
+// to refuse to link from a source that's missing the install completion
+// sentinel, so that a cache left corrupt by an interrupted init isn't
+// propagated into a second cache. It should be left unset for a source that
+// comes directly from a filesystem mirror, which was never written by
+// installExtractedAtomically in the first place.
+func installFromLocalDir(ctx context.Context, meta getproviders.PackageMeta, targetDir string, linkMode installFromLocalDirLinkMode, requireSourceSentinel bool) (*getproviders.PackageAuthenticationResult, error) {
 	sourceDir := meta.Location.String()
 
 	absNew, err := filepath.Abs(targetDir)
@@ -126,6 +566,10 @@ func installFromLocalDir(ctx context.Context, meta getproviders.PackageMeta, tar
 		return nil, fmt.Errorf("failed to make source path %s absolute: %s", sourceDir, err)
 	}
 
+	if requireSourceSentinel && !providerInstallIsComplete(absCurrent) {
+		return nil, fmt.Errorf("cannot link from %s because it does not look like a complete provider installation (missing %s)", sourceDir, providerInstallSentinelFilename)
+	}
+
 	// Before we do anything else, we'll do a quick check to make sure that
 	// these two paths are not pointing at the same physical directory on
 	// disk. This compares the files by their OS-level device and directory
@@ -136,12 +580,6 @@ func installFromLocalDir(ctx context.Context, meta getproviders.PackageMeta, tar
 		return nil, fmt.Errorf("failed to determine if %s and %s are the same: %s", sourceDir, targetDir, err)
 	}
 
-	// Delete anything that's already present at this path first.
-	err = os.RemoveAll(targetDir)
-	if err != nil && !os.IsNotExist(err) {
-		return nil, fmt.Errorf("failed to remove existing %s before linking it to %s: %s", sourceDir, targetDir, err)
-	}
-
 	// We'll prefer to create a symlink if possible, but we'll fall back to
 	// a recursive copy if symlink creation fails. It could fail for a number
 	// of reasons, including being on Windows 8 without administrator
@@ -156,20 +594,43 @@ func installFromLocalDir(ctx context.Context, meta getproviders.PackageMeta, tar
 	linkTarget := absCurrent
 
 	parentDir := filepath.Dir(absNew)
-	err = os.MkdirAll(parentDir, 0755)
-	if err != nil && os.IsExist(err) {
+	if err := os.MkdirAll(parentDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create parent directories leading to %s: %s", targetDir, err)
 	}
 
-	err = os.Symlink(linkTarget, absNew)
-	if err == nil {
-		// Success, then!
+	// We create the symlink at a fresh sibling path and swap it into place
+	// with the same old-aside-then-rename dance installExtractedAtomically
+	// uses (see swapDirIntoPlace), rather than removing whatever's already
+	// at targetDir first, so a failed install puts the previous one back
+	// instead of leaving targetDir missing.
+	tmpLink, err := ioutil.TempDir(parentDir, filepath.Base(absNew)+providerInstallTempDirSuffixes[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory to link into: %s", err)
+	}
+	os.RemoveAll(tmpLink) // free up the name again so os.Symlink can claim it itself
+	defer os.RemoveAll(tmpLink) // no-op once it's been renamed into place below
+
+	if err := os.Symlink(linkTarget, tmpLink); err == nil {
+		if err := swapDirIntoPlace(absNew, tmpLink); err != nil {
+			return nil, fmt.Errorf("failed to link %s to %s: %s", absCurrent, absNew, err)
+		}
 		return nil, nil
 	}
 
 	// If we get down here then symlinking failed and we need a deep copy
-	// instead.
-	err = copydir.CopyDir(absNew, absCurrent)
+	// instead, either a full byte-for-byte copy or, if requested and the
+	// source and target happen to share a filesystem, a hardlink-based copy
+	// that avoids duplicating file contents on disk. We extract into a
+	// sibling temporary directory and only swap it into place once it's
+	// fully populated, so an interrupted copy can never look like a valid
+	// cache entry.
+	copyFlags := copydir.CopyDefault
+	if linkMode == installFromLocalDirLinkModeHardlink {
+		copyFlags = copydir.CopyHardlink
+	}
+	err = installExtractedAtomically(absNew, func(tmpDir string) error {
+		return copydir.CopyDir(tmpDir, absCurrent, copyFlags)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to either symlink or copy %s to %s: %s", absCurrent, absNew, err)
 	}
@@ -177,3 +638,336 @@ func installFromLocalDir(ctx context.Context, meta getproviders.PackageMeta, tar
 	// If we got here then apparently our copy succeeded, so we're done.
 	return nil, nil
 }
+
+// installerEvents is the set of optional callbacks that installPackages
+// reports progress through as it installs a batch of packages. Any nil
+// field is simply not called. This mirrors the shape of the InstallerEvents
+// hook that the single-package install path already reports through, so
+// that callers can use the same UI code for both.
+type installerEvents struct {
+	FetchPackageBegin     func(provider addrs.Provider, total int64)
+	FetchPackageProgress  func(provider addrs.Provider, downloaded, total int64)
+	FetchPackageSuccess   func(provider addrs.Provider)
+	ExtractPackageBegin   func(provider addrs.Provider)
+	ExtractPackageSuccess func(provider addrs.Provider)
+}
+
+// defaultProviderDownloadConcurrency is how many providers installPackages
+// will fetch and extract at once when TF_PROVIDER_DOWNLOAD_CONCURRENCY
+// isn't set.
+const defaultProviderDownloadConcurrency = 4
+
+// providerDownloadConcurrency returns the configured worker pool size for
+// installPackages, honoring TF_PROVIDER_DOWNLOAD_CONCURRENCY if it's set to
+// a positive integer.
+func providerDownloadConcurrency() int {
+	if v := os.Getenv("TF_PROVIDER_DOWNLOAD_CONCURRENCY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultProviderDownloadConcurrency
+}
+
+// localDirLinkModeEnvVar lets operators opt the global plugin cache
+// directory into hardlink-based installs instead of full copies, for
+// filesystems (legacy FAT, Windows without administrator privileges) where
+// installFromLocalDir can't fall back on a symlink.
+const localDirLinkModeEnvVar = "TF_PLUGIN_CACHE_MAY_HARDLINK"
+
+// localDirLinkMode returns the installFromLocalDirLinkMode that
+// installPackage should use when a symlink isn't available, honoring
+// localDirLinkModeEnvVar.
+func localDirLinkMode() installFromLocalDirLinkMode {
+	if v, err := strconv.ParseBool(os.Getenv(localDirLinkModeEnvVar)); err == nil && v {
+		return installFromLocalDirLinkModeHardlink
+	}
+	return installFromLocalDirLinkModeCopy
+}
+
+// LinkFromOtherCache links a provider package that's already installed in
+// another plugin cache directory into targetDir, preferring a symlink and
+// falling back to linkMode's deep-copy strategy when a symlink isn't
+// possible.
+//
+// Unlike installPackage's PackageLocalDir handling, this refuses to link
+// from a source cache entry that's missing its install completion
+// sentinel, so that a cache left corrupt by an interrupted init is never
+// propagated into a second cache via a link.
+func LinkFromOtherCache(ctx context.Context, meta getproviders.PackageMeta, targetDir string, linkMode installFromLocalDirLinkMode) (*getproviders.PackageAuthenticationResult, error) {
+	return installFromLocalDir(ctx, meta, targetDir, linkMode, true)
+}
+
+// installPackage dispatches to the appropriate installFrom* helper based on
+// the concrete type of meta.Location.
+//
+// onFetchComplete, if non-nil, is called once any remote fetch has
+// finished and extraction is about to begin, so a caller can report a
+// distinct extraction phase. Package sources that don't involve a
+// separate fetch (a local archive or a local directory) call it
+// immediately, since there's no fetch phase to distinguish it from.
+func installPackage(ctx context.Context, meta getproviders.PackageMeta, targetDir string, progress progressFunc, onFetchComplete func()) (*getproviders.PackageAuthenticationResult, error) {
+	switch meta.Location.(type) {
+	case getproviders.PackageHTTPURL:
+		return installFromHTTPURL(ctx, meta, targetDir, progress, onFetchComplete)
+	case getproviders.PackageLocalArchive:
+		if onFetchComplete != nil {
+			onFetchComplete()
+		}
+		return installFromLocalArchive(ctx, meta, targetDir)
+	case getproviders.PackageLocalDir:
+		if onFetchComplete != nil {
+			onFetchComplete()
+		}
+		return installFromLocalDir(ctx, meta, targetDir, localDirLinkMode(), false)
+	default:
+		return nil, fmt.Errorf("don't know how to install a package from %s", meta.Location)
+	}
+}
+
+// installPackages installs each of the given packages into its
+// corresponding target directory using a bounded pool of goroutines, so
+// that terraform init doesn't pay for downloading and extracting every
+// provider strictly one at a time. A failure installing any one package
+// cancels ctx for the rest; the first error encountered (not necessarily
+// from the first package in iteration order) is returned.
+func installPackages(ctx context.Context, pkgs map[addrs.Provider]getproviders.PackageMeta, targetDirs map[addrs.Provider]string, events *installerEvents) (map[addrs.Provider]*getproviders.PackageAuthenticationResult, error) {
+	// Before trusting anything already sitting in the cache, clear out any
+	// directory that a previous, interrupted init left behind partway
+	// through extracting a package, so we don't mistake it for a valid
+	// install and skip reinstalling it.
+	prunedParents := make(map[string]bool)
+	for _, dir := range targetDirs {
+		parent := filepath.Dir(dir)
+		if prunedParents[parent] {
+			continue
+		}
+		prunedParents[parent] = true
+		if err := pruneIncompleteProviderDirs(parent); err != nil {
+			return nil, fmt.Errorf("failed to clean up provider plugin cache: %s", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		provider   addrs.Provider
+		authResult *getproviders.PackageAuthenticationResult
+		err        error
+	}
+
+	concurrency := providerDownloadConcurrency()
+	if concurrency > len(pkgs) {
+		concurrency = len(pkgs)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	work := make(chan addrs.Provider)
+	results := make(chan result)
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for provider := range work {
+				meta := pkgs[provider]
+
+				if events != nil && events.FetchPackageBegin != nil {
+					events.FetchPackageBegin(provider, -1)
+				}
+				var progress progressFunc
+				if events != nil && events.FetchPackageProgress != nil {
+					progress = func(downloaded, total int64) {
+						events.FetchPackageProgress(provider, downloaded, total)
+					}
+				}
+				var onFetchComplete func()
+				if events != nil {
+					onFetchComplete = func() {
+						if events.FetchPackageSuccess != nil {
+							events.FetchPackageSuccess(provider)
+						}
+						if events.ExtractPackageBegin != nil {
+							events.ExtractPackageBegin(provider)
+						}
+					}
+				}
+
+				authResult, err := installPackage(ctx, meta, targetDirs[provider], progress, onFetchComplete)
+				if err == nil {
+					if events != nil && events.ExtractPackageSuccess != nil {
+						events.ExtractPackageSuccess(provider)
+					}
+				}
+
+				select {
+				case results <- result{provider, authResult, err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(work)
+		for provider := range pkgs {
+			select {
+			case work <- provider:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	authResults := make(map[addrs.Provider]*getproviders.PackageAuthenticationResult, len(pkgs))
+	var firstErr error
+	for res := range results {
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to install %s: %s", res.provider, res.err)
+				cancel()
+			}
+			continue
+		}
+		authResults[res.provider] = res.authResult
+	}
+
+	return authResults, firstErr
+}
+
+// providerInstallSentinelFilename is the name of the zero-byte marker file
+// that installExtractedAtomically writes into a package directory once it's
+// been fully extracted, so a directory left behind by an interrupted init
+// can be told apart from a genuinely complete install. This mirrors the
+// unpackedOkay pattern the Go toolchain uses for its own version cache.
+const providerInstallSentinelFilename = ".terraform-provider-ok"
+
+// providerInstallIsComplete reports whether dir contains the completion
+// sentinel written by installExtractedAtomically.
+func providerInstallIsComplete(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, providerInstallSentinelFilename))
+	return err == nil
+}
+
+// providerInstallTempDirSuffixes lists the name suffixes installExtractedAtomically
+// uses for the sibling directories it creates next to targetDir while an
+// install is in progress. A directory bearing one of these suffixes is
+// never a real, final provider installation, regardless of whether it
+// happens to contain a sentinel file, so pruneIncompleteProviderDirs always
+// removes them outright rather than checking for the sentinel.
+var providerInstallTempDirSuffixes = []string{".partial-", ".old-"}
+
+// installExtractedAtomically calls extract to populate a fresh temporary
+// directory and, only once extract has returned successfully, atomically
+// swaps it into targetDir and marks it complete with the sentinel file.
+//
+// This means an init interrupted partway through extraction leaves behind
+// only an orphaned temporary directory next to targetDir, rather than a
+// half-extracted targetDir that a later run would otherwise mistake for a
+// valid, complete package.
+func installExtractedAtomically(targetDir string, extract func(tmpDir string) error) error {
+	parentDir := filepath.Dir(targetDir)
+	if err := os.MkdirAll(parentDir, 0755); err != nil {
+		return fmt.Errorf("failed to create parent directories leading to %s: %s", targetDir, err)
+	}
+
+	tmpDir, err := ioutil.TempDir(parentDir, filepath.Base(targetDir)+providerInstallTempDirSuffixes[0])
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory to extract into: %s", err)
+	}
+	defer os.RemoveAll(tmpDir) // no-op once it's been renamed into place below
+
+	if err := extract(tmpDir); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, providerInstallSentinelFilename), nil, 0644); err != nil {
+		return fmt.Errorf("failed to finalize %s: %s", targetDir, err)
+	}
+
+	return swapDirIntoPlace(targetDir, tmpDir)
+}
+
+// swapDirIntoPlace moves newDir into targetDir's place, first moving
+// whatever's currently at targetDir aside rather than removing it and then
+// renaming, so targetDir never holds a partly-populated install and a
+// failure of the second rename puts the previous install back. The two
+// renames aren't one atomic step: if we're killed between them, targetDir
+// is absent and the previous install is left in an orphaned ".old-" entry,
+// which pruneIncompleteProviderDirs removes on the next startup scan.
+//
+// newDir must already be in its final, ready-to-serve form: once it's
+// renamed into place there's no further opportunity to finish populating
+// it.
+func swapDirIntoPlace(targetDir, newDir string) error {
+	oldDir := targetDir + providerInstallTempDirSuffixes[1] + filepath.Base(newDir)
+	movedOldAside := false
+	if err := os.Rename(targetDir, oldDir); err == nil {
+		movedOldAside = true
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to move existing %s out of the way: %s", targetDir, err)
+	}
+
+	if err := os.Rename(newDir, targetDir); err != nil {
+		if movedOldAside {
+			// Best-effort: put the previous install back so a failed
+			// install doesn't also destroy a previously-working one.
+			os.Rename(oldDir, targetDir)
+		}
+		return fmt.Errorf("failed to move %s into place at %s: %s", newDir, targetDir, err)
+	}
+
+	if movedOldAside {
+		os.RemoveAll(oldDir)
+	}
+
+	return nil
+}
+
+// pruneIncompleteProviderDirs scans the immediate children of cacheDir and
+// removes any that are either one of installExtractedAtomically's own
+// temporary working directories or missing the install completion
+// sentinel, on the assumption that they're leftovers from an init that was
+// interrupted partway through extracting or swapping in a package.
+// installPackages calls this once per cache directory before trusting
+// anything it finds there. Temporary entries are removed whether they're
+// directories or symlinks; any other entry that isn't a directory, such as
+// a package installed as a symlink, is left alone.
+func pruneIncompleteProviderDirs(cacheDir string) error {
+	entries, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		dir := filepath.Join(cacheDir, entry.Name())
+
+		isTemp := false
+		for _, suffix := range providerInstallTempDirSuffixes {
+			if strings.Contains(entry.Name(), suffix) {
+				isTemp = true
+				break
+			}
+		}
+
+		if !isTemp && (!entry.IsDir() || providerInstallIsComplete(dir)) {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove corrupt cache entry %s: %s", dir, err)
+		}
+	}
+	return nil
+}